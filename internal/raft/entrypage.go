@@ -0,0 +1,89 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import pb "github.com/lni/dragonboat/raftpb"
+
+// entryPageSize bounds how many entries a single EntryPage holds, it is
+// the unstable log's allocation unit. Appending beyond it rolls over to
+// a freshly allocated page rather than growing and copying one big
+// slice, which is what resizeEntrySlice used to do on every refill.
+const entryPageSize = 512
+
+// EntryPage is a fixed-capacity arena of log entries. inMemory allocates
+// pages from a pageList and, when the requested range sits within a
+// single page, hands that page's backing array to the persistence path
+// (EntriesToSave) as is. A range that spans pages is assembled into a
+// newly allocated slice of entries (their Cmd payloads are shared, not
+// copied), and spilled entries are read back from disk. Callers must not
+// retain the slice returned by Entries past the page's next mutation or
+// release.
+//
+// refs/Acquire/Release are bookkeeping for a holder beyond inMemory's own
+// implicit one, e.g. an outbound replication path that needs to keep a
+// page alive until its own transport ack lands (see the package level
+// TODO in pagelist.go). Pages are plain heap allocations, not pooled:
+// pooling would only be safe once something actually calls Acquire to
+// extend a page's lifetime past the point inMemory drops it, and nothing
+// does yet.
+type EntryPage struct {
+	entries []pb.Entry
+	refs    int32
+}
+
+func newEntryPage() *EntryPage {
+	return &EntryPage{entries: make([]pb.Entry, 0, entryPageSize), refs: 1}
+}
+
+// Acquire records another holder of the page, callers must call Release
+// once they are done reading Entries().
+func (p *EntryPage) Acquire() {
+	p.refs++
+}
+
+// Release drops a holder recorded by Acquire. inMemory itself holds an
+// implicit reference for as long as a page is part of its page list, on
+// top of whatever callers acquire explicitly.
+func (p *EntryPage) Release() {
+	p.refs--
+}
+
+// Entries returns the page's resident entries. The returned slice is
+// only valid until the page is appended to again or recycled.
+func (p *EntryPage) Entries() []pb.Entry {
+	return p.entries
+}
+
+func (p *EntryPage) full() bool {
+	return len(p.entries) == entryPageSize
+}
+
+func (p *EntryPage) firstIndex() (uint64, bool) {
+	if len(p.entries) == 0 {
+		return 0, false
+	}
+	return p.entries[0].Index, true
+}
+
+func (p *EntryPage) lastIndex() (uint64, bool) {
+	if len(p.entries) == 0 {
+		return 0, false
+	}
+	return p.entries[len(p.entries)-1].Index, true
+}
+
+func (p *EntryPage) append(ent pb.Entry) {
+	p.entries = append(p.entries, ent)
+}
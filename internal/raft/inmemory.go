@@ -20,37 +20,67 @@ import (
 )
 
 var (
-	entrySliceSize    = settings.Soft.InMemEntrySliceSize
-	minEntrySliceSize = settings.Soft.MinEntrySliceFreeSize
+	spillByteThreshold  = settings.Soft.InMemEntrySpillByteThreshold
+	spillEntryThreshold = settings.Soft.InMemEntrySpillEntryThreshold
 )
 
-// inMemory is a two stage in memory log storage struct to keep log entries
-// that will be used by the raft protocol in immediate future.
+// inMemory is the default UnstableLog implementation, a two stage in
+// memory log storage struct to keep log entries that will be used by the
+// raft protocol in immediate future. Entries are held in a pageList of
+// fixed-size EntryPages rather than one flat slice, so growing the tail
+// never reallocates and copies everything seen so far, and a page can be
+// shared read-only with other consumers instead of being copied for
+// each of them. Once the unsaved tail grows past the configured spill
+// thresholds, its oldest entries are moved out of the process heap into
+// an on-disk entrySpill and faulted back in on demand, see setSpillDir
+// and maybeSpill. A snapshot being streamed in from the network is
+// staged separately, see beginRestore/appendChunk, and only replaces the
+// committed snapshot once finalizeRestore is called.
 type inMemory struct {
 	snapshot    *pb.Snapshot
-	entries     []pb.Entry
+	pl          pageList
 	markerIndex uint64
 	savedTo     uint64
+
+	spill        *entrySpill
+	residentFrom uint64
+	spilledBytes uint64
+	spillCount   uint64
+	faultCount   uint64
+
+	pending *pendingSnapshot
 }
 
 func newInMemory(lastIndex uint64) inMemory {
 	return inMemory{
-		markerIndex: lastIndex + 1,
-		savedTo:     lastIndex,
+		markerIndex:  lastIndex + 1,
+		residentFrom: lastIndex + 1,
+		savedTo:      lastIndex,
 	}
 }
 
+// setSpillDir enables spill-to-disk for the unsaved tail of the unstable
+// log, staging overflow segments under dir. It must be called before any
+// entries are merged in, passing an empty dir disables spilling.
+func (im *inMemory) setSpillDir(dir string) {
+	if dir == "" {
+		im.spill = nil
+		return
+	}
+	im.spill = newEntrySpill(dir)
+}
+
 func (im *inMemory) checkMarkerIndex() {
-	if len(im.entries) > 0 {
-		if im.entries[0].Index != im.markerIndex {
-			plog.Panicf("marker index %d, first index %d",
-				im.markerIndex, im.entries[0].Index)
+	if im.pl.len() > 0 {
+		if first := im.pl.entryAt(0).Index; first != im.residentFrom {
+			plog.Panicf("resident from %d, first index %d", im.residentFrom, first)
 		}
 	}
 }
 
-func (im *inMemory) getEntries(low uint64, high uint64) []pb.Entry {
-	upperBound := im.markerIndex + uint64(len(im.entries))
+// GetEntries implements the UnstableLog interface.
+func (im *inMemory) GetEntries(low uint64, high uint64) []pb.Entry {
+	upperBound := im.residentFrom + uint64(im.pl.len())
 	if low > high || low < im.markerIndex {
 		plog.Panicf("invalid low value %d, high %d, marker index %d",
 			low, high, im.markerIndex)
@@ -58,7 +88,22 @@ func (im *inMemory) getEntries(low uint64, high uint64) []pb.Entry {
 	if high > upperBound {
 		plog.Panicf("invalid high value %d, upperBound %d", high, upperBound)
 	}
-	return im.entries[low-im.markerIndex : high-im.markerIndex]
+	if low >= im.residentFrom {
+		return im.pl.slice(int(low-im.residentFrom), int(high-im.residentFrom))
+	}
+	spillHigh := high
+	if spillHigh > im.residentFrom {
+		spillHigh = im.residentFrom
+	}
+	spilled, err := im.spill.fault(low, spillHigh)
+	if err != nil {
+		plog.Panicf("failed to fault spilled entries [%d,%d), %v", low, spillHigh, err)
+	}
+	im.faultCount++
+	if high <= im.residentFrom {
+		return spilled
+	}
+	return append(spilled, im.pl.slice(0, int(high-im.residentFrom))...)
 }
 
 func (im *inMemory) getSnapshotIndex() (uint64, bool) {
@@ -68,28 +113,38 @@ func (im *inMemory) getSnapshotIndex() (uint64, bool) {
 	return 0, false
 }
 
-func (im *inMemory) getLastIndex() (uint64, bool) {
-	if len(im.entries) > 0 {
-		return im.entries[len(im.entries)-1].Index, true
+// GetLastIndex implements the UnstableLog interface.
+func (im *inMemory) GetLastIndex() (uint64, bool) {
+	if n := im.pl.len(); n > 0 {
+		return im.pl.entryAt(n - 1).Index, true
+	}
+	if im.residentFrom > im.markerIndex {
+		return im.residentFrom - 1, true
 	}
 	return im.getSnapshotIndex()
 }
 
-func (im *inMemory) getTerm(index uint64) (uint64, bool) {
+// GetTerm implements the UnstableLog interface.
+func (im *inMemory) GetTerm(index uint64) (uint64, bool) {
 	if index < im.markerIndex {
 		if idx, ok := im.getSnapshotIndex(); ok && idx == index {
 			return im.snapshot.Term, true
 		}
 		return 0, false
 	}
-	lastIndex, ok := im.getLastIndex()
-	if ok && index <= lastIndex {
-		return im.entries[index-im.markerIndex].Term, true
+	lastIndex, ok := im.GetLastIndex()
+	if !ok || index > lastIndex {
+		return 0, false
 	}
-	return 0, false
+	ents := im.GetEntries(index, index+1)
+	if len(ents) == 0 {
+		return 0, false
+	}
+	return ents[0].Term, true
 }
 
-func (im *inMemory) commitUpdate(cu pb.UpdateCommit) {
+// CommitUpdate implements the UnstableLog interface.
+func (im *inMemory) CommitUpdate(cu pb.UpdateCommit) {
 	if cu.StableLogTo > 0 {
 		im.savedLogTo(cu.StableLogTo, cu.StableLogTerm)
 	}
@@ -98,43 +153,54 @@ func (im *inMemory) commitUpdate(cu pb.UpdateCommit) {
 	}
 }
 
-func (im *inMemory) entriesToSave() []pb.Entry {
+// EntriesToSave implements the UnstableLog interface.
+func (im *inMemory) EntriesToSave() []pb.Entry {
 	idx := im.savedTo + 1
-	if idx-im.markerIndex > uint64(len(im.entries)) {
+	lastIndex, ok := im.GetLastIndex()
+	if !ok || idx > lastIndex {
 		plog.Infof("nothing to save %+v", im)
 		return []pb.Entry{}
 	}
-	return im.entries[idx-im.markerIndex:]
+	return im.GetEntries(idx, lastIndex+1)
 }
 
+// savedLogTo records that entries up to and including index have been
+// acknowledged by stable storage. It must not reclaim their spilled
+// copies: inMemory is still required to serve everything in
+// [markerIndex, lastIndex], saved or not, and only AppliedLogTo advances
+// markerIndex far enough to know a spill segment can be dropped for good.
 func (im *inMemory) savedLogTo(index uint64, term uint64) {
 	if index < im.markerIndex {
 		return
 	}
-	if len(im.entries) == 0 {
+	lastIndex, ok := im.GetLastIndex()
+	if !ok || index > lastIndex {
 		return
 	}
-	if index > im.entries[len(im.entries)-1].Index ||
-		term != im.entries[index-im.markerIndex].Term {
+	if savedTerm, ok := im.GetTerm(index); !ok || savedTerm != term {
 		return
 	}
 	im.savedTo = index
 }
 
-func (im *inMemory) appliedLogTo(index uint64) {
+// AppliedLogTo implements the UnstableLog interface.
+func (im *inMemory) AppliedLogTo(index uint64) {
 	if index < im.markerIndex {
 		return
 	}
-	if len(im.entries) == 0 {
-		return
-	}
-	if index > im.entries[len(im.entries)-1].Index {
+	lastIndex, ok := im.GetLastIndex()
+	if !ok || index > lastIndex {
 		return
 	}
 	newMarkerIndex := index
-	im.entries = im.entries[newMarkerIndex-im.markerIndex:]
+	if newMarkerIndex > im.residentFrom {
+		im.pl.dropPrefix(int(newMarkerIndex - im.residentFrom))
+		im.residentFrom = newMarkerIndex
+	}
 	im.markerIndex = newMarkerIndex
-	im.resizeEntrySlice()
+	if im.spill != nil {
+		im.spill.drop(newMarkerIndex)
+	}
 	im.checkMarkerIndex()
 }
 
@@ -146,39 +212,96 @@ func (im *inMemory) savedSnapshotTo(index uint64) {
 	}
 }
 
-func (im *inMemory) resizeEntrySlice() {
-	if cap(im.entries)-len(im.entries) < int(minEntrySliceSize) {
-		old := im.entries
-		im.entries = make([]pb.Entry, 0, entrySliceSize)
-		im.entries = append(im.entries, old...)
+// maybeSpill offloads resident entries to disk once the unsaved tail
+// (entries with index > savedTo) has grown past the configured
+// byte/count thresholds, keeping the heap bounded when the stable log
+// writer falls behind a sustained write burst. At least one entry is
+// always kept resident. The threshold is checked against the unsaved
+// tail only, not the whole resident window, so entries that are already
+// saved but not yet applied don't force repeated, ever-larger rescans.
+func (im *inMemory) maybeSpill() {
+	if im.spill == nil {
+		return
+	}
+	residentCount := im.pl.len()
+	if residentCount <= 1 {
+		return
+	}
+	unsavedFrom := im.savedTo + 1
+	if unsavedFrom < im.residentFrom {
+		unsavedFrom = im.residentFrom
 	}
+	offset := int(unsavedFrom - im.residentFrom)
+	var unsavedBytes uint64
+	for i := offset; i < residentCount; i++ {
+		unsavedBytes += uint64(im.pl.entryAt(i).SizeUpperLimit())
+	}
+	unsavedCount := residentCount - offset
+	if unsavedBytes <= spillByteThreshold && uint64(unsavedCount) <= spillEntryThreshold {
+		return
+	}
+	spillCount := residentCount - 1
+	seg, err := im.spill.spill(im.pl.slice(0, spillCount))
+	if err != nil {
+		plog.Errorf("failed to spill unstable log entries to disk, %v", err)
+		return
+	}
+	im.pl.dropPrefix(spillCount)
+	im.residentFrom = seg.high
+	im.spilledBytes += seg.bytes
+	im.spillCount++
+}
+
+// SpillMetrics reports the cumulative bytes spilled to disk and the
+// number of spill/fault operations performed so far, for the node's
+// metrics reporter to export alongside its other raft gauges.
+func (im *inMemory) SpillMetrics() (spilledBytes uint64, spillCount uint64, faultCount uint64) {
+	return im.spilledBytes, im.spillCount, im.faultCount
 }
 
-func (im *inMemory) merge(ents []pb.Entry) {
+// Merge implements the UnstableLog interface.
+func (im *inMemory) Merge(ents []pb.Entry) {
 	firstNewIndex := ents[0].Index
-	im.resizeEntrySlice()
-	if firstNewIndex == im.markerIndex+uint64(len(im.entries)) {
-		checkEntriesToAppend(im.entries, ents)
-		im.entries = append(im.entries, ents...)
+	if firstNewIndex == im.residentFrom+uint64(im.pl.len()) {
+		var existing []pb.Entry
+		if n := im.pl.len(); n > 0 {
+			existing = im.pl.slice(n-1, n)
+		}
+		checkEntriesToAppend(existing, ents)
+		im.pl.append(ents)
 	} else if firstNewIndex <= im.markerIndex {
 		im.markerIndex = firstNewIndex
-		// ents might come from entryQueue, copy it to its own storage
-		im.entries = newEntrySlice(ents)
+		im.residentFrom = firstNewIndex
+		im.pl.reset()
+		im.pl.append(ents)
 		im.savedTo = firstNewIndex - 1
+		if im.spill != nil {
+			im.spill.purge()
+		}
 	} else {
-		existing := im.getEntries(im.markerIndex, firstNewIndex)
+		existing := im.GetEntries(im.markerIndex, firstNewIndex)
 		checkEntriesToAppend(existing, ents)
-		im.entries = make([]pb.Entry, 0, len(existing)+len(ents))
-		im.entries = append(im.entries, existing...)
-		im.entries = append(im.entries, ents...)
+		im.pl.reset()
+		im.pl.append(existing)
+		im.pl.append(ents)
+		im.residentFrom = im.markerIndex
 		im.savedTo = min(im.savedTo, firstNewIndex-1)
+		if im.spill != nil {
+			im.spill.purge()
+		}
 	}
+	im.maybeSpill()
 	im.checkMarkerIndex()
 }
 
-func (im *inMemory) restore(ss pb.Snapshot) {
+// Restore implements the UnstableLog interface.
+func (im *inMemory) Restore(ss pb.Snapshot) {
 	im.snapshot = &ss
 	im.markerIndex = ss.Index + 1
-	im.entries = nil
+	im.residentFrom = im.markerIndex
+	im.pl.reset()
 	im.savedTo = ss.Index
+	if im.spill != nil {
+		im.spill.purge()
+	}
 }
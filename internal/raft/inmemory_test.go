@@ -0,0 +1,56 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"testing"
+
+	pb "github.com/lni/dragonboat/raftpb"
+)
+
+// TestAppliedLogToNonPageAlignedPrefix covers the default (no-spill) path
+// where the resident log spans more than one EntryPage and AppliedLogTo
+// drops a prefix that doesn't land on a page boundary, leaving the new
+// first page partially consumed and the partly filled tail page after it
+// untouched.
+func TestAppliedLogToNonPageAlignedPrefix(t *testing.T) {
+	im := newInMemory(0)
+	total := 2*entryPageSize + 8
+	for i := 1; i <= total; i++ {
+		im.Merge([]pb.Entry{{Index: uint64(i), Term: 1}})
+	}
+
+	const appliedTo = entryPageSize + 100
+	im.CommitUpdate(pb.UpdateCommit{StableLogTo: appliedTo, StableLogTerm: 1})
+	im.AppliedLogTo(appliedTo)
+
+	lastIndex, ok := im.GetLastIndex()
+	if !ok || lastIndex != uint64(total) {
+		t.Fatalf("GetLastIndex() got %d, %v, want %d, true", lastIndex, ok, total)
+	}
+	ents := im.GetEntries(appliedTo+1, lastIndex+1)
+	want := total - appliedTo
+	if len(ents) != want {
+		t.Fatalf("GetEntries returned %d entries, want %d", len(ents), want)
+	}
+	for i, ent := range ents {
+		if want := uint64(appliedTo) + 1 + uint64(i); ent.Index != want {
+			t.Fatalf("entry %d has index %d, want %d", i, ent.Index, want)
+		}
+	}
+	if term, ok := im.GetTerm(lastIndex); !ok || term != 1 {
+		t.Fatalf("GetTerm(lastIndex) got %d, %v, want 1, true", term, ok)
+	}
+}
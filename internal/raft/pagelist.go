@@ -0,0 +1,145 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import pb "github.com/lni/dragonboat/raftpb"
+
+// TODO(raft): the outbound message builder still copies entries out of
+// GetEntries instead of acquiring the backing EntryPage directly. Once
+// raft.makeReplicateMessage does that, pages can stay shared all the way
+// to the transport layer and be released only once both the stable
+// storage ack and the transport ack have been observed.
+
+// pageList is an ordered list of EntryPages that together represent a
+// contiguous run of resident log entries. It is the page-list
+// bookkeeping that replaced the single []pb.Entry slice that used to be
+// grown (and copied) by resizeEntrySlice. Every page but pages[0] and the
+// tail page is always exactly entryPageSize long; pages[0] can be
+// shorter than that once dropPrefix has trimmed a non-page-aligned
+// prefix off its front, which headOffset accounts for.
+type pageList struct {
+	pages      []*EntryPage
+	headOffset int
+}
+
+// firstPageLen returns how many resident entries pages[0] still holds
+// once headOffset is taken into account.
+func (pl *pageList) firstPageLen() int {
+	if len(pl.pages) == 0 {
+		return 0
+	}
+	return len(pl.pages[0].entries) - pl.headOffset
+}
+
+func (pl *pageList) len() int {
+	if len(pl.pages) == 0 {
+		return 0
+	}
+	if len(pl.pages) == 1 {
+		return pl.firstPageLen()
+	}
+	n := pl.firstPageLen()
+	n += (len(pl.pages) - 2) * entryPageSize
+	n += len(pl.pages[len(pl.pages)-1].entries)
+	return n
+}
+
+// append adds ents to the tail of the page list, rolling over to a new
+// page whenever the current tail page is full rather than reallocating
+// and copying everything seen so far.
+func (pl *pageList) append(ents []pb.Entry) {
+	for _, ent := range ents {
+		if len(pl.pages) == 0 || pl.pages[len(pl.pages)-1].full() {
+			pl.pages = append(pl.pages, newEntryPage())
+		}
+		pl.pages[len(pl.pages)-1].append(ent)
+	}
+}
+
+// locate translates offset i (0 based, relative to the first resident
+// entry) into the page holding it and the offset within that page's own
+// entries slice, accounting for headOffset on pages[0].
+func (pl *pageList) locate(i int) (pageIdx int, offset int) {
+	firstLen := pl.firstPageLen()
+	if i < firstLen {
+		return 0, pl.headOffset + i
+	}
+	i -= firstLen
+	return 1 + i/entryPageSize, i % entryPageSize
+}
+
+// entryAt returns the entry at offset i (0 based, relative to the first
+// resident entry).
+func (pl *pageList) entryAt(i int) pb.Entry {
+	pageIdx, offset := pl.locate(i)
+	return pl.pages[pageIdx].entries[offset]
+}
+
+// slice materialises the entries in [low, high) (offsets relative to the
+// first resident entry) into a single contiguous slice. When the range
+// sits entirely within one page the page's own backing array is reused
+// rather than copied.
+func (pl *pageList) slice(low int, high int) []pb.Entry {
+	if low == high {
+		return []pb.Entry{}
+	}
+	firstPage, firstOffset := pl.locate(low)
+	lastPage, lastOffset := pl.locate(high - 1)
+	if firstPage == lastPage {
+		page := pl.pages[firstPage]
+		return page.entries[firstOffset : lastOffset+1]
+	}
+	result := make([]pb.Entry, 0, high-low)
+	for i := low; i < high; {
+		pageIdx, offset := pl.locate(i)
+		page := pl.pages[pageIdx]
+		end := len(page.entries)
+		if pageIdx == lastPage {
+			end = lastOffset + 1
+		}
+		result = append(result, page.entries[offset:end]...)
+		i += end - offset
+	}
+	return result
+}
+
+// dropPrefix drops the first n resident entries, releasing any page that
+// becomes fully consumed so its storage can be reused. A partial drop
+// that leaves pages[0] non-page-aligned is tracked via headOffset rather
+// than by re-slicing the page's entries, so later pages keep addressing
+// correctly off their fixed entryPageSize stride.
+func (pl *pageList) dropPrefix(n int) {
+	for n > 0 && len(pl.pages) > 0 {
+		remaining := pl.firstPageLen()
+		if n < remaining {
+			pl.headOffset += n
+			return
+		}
+		n -= remaining
+		pl.pages[0].Release()
+		pl.pages[0] = nil
+		pl.pages = pl.pages[1:]
+		pl.headOffset = 0
+	}
+}
+
+// reset releases every page held by the list.
+func (pl *pageList) reset() {
+	for _, page := range pl.pages {
+		page.Release()
+	}
+	pl.pages = nil
+	pl.headOffset = 0
+}
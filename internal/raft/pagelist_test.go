@@ -0,0 +1,54 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"testing"
+
+	pb "github.com/lni/dragonboat/raftpb"
+)
+
+func TestPageListDropPrefixNonPageAligned(t *testing.T) {
+	var pl pageList
+	total := entryPageSize + 8
+	ents := make([]pb.Entry, 0, total)
+	for i := 1; i <= total; i++ {
+		ents = append(ents, pb.Entry{Index: uint64(i)})
+	}
+	pl.append(ents)
+	if pl.len() != total {
+		t.Fatalf("len() got %d, want %d", pl.len(), total)
+	}
+
+	const drop = 100
+	pl.dropPrefix(drop)
+	want := total - drop
+	if pl.len() != want {
+		t.Fatalf("len() after dropPrefix got %d, want %d", pl.len(), want)
+	}
+	if first := pl.entryAt(0).Index; first != uint64(drop+1) {
+		t.Fatalf("entryAt(0).Index got %d, want %d", first, drop+1)
+	}
+
+	got := pl.slice(0, pl.len())
+	if len(got) != want {
+		t.Fatalf("slice(0, len()) returned %d entries, want %d", len(got), want)
+	}
+	for i, ent := range got {
+		if ent.Index != uint64(drop+1+i) {
+			t.Fatalf("entry %d has index %d, want %d", i, ent.Index, drop+1+i)
+		}
+	}
+}
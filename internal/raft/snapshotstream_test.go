@@ -0,0 +1,71 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"hash/crc32"
+	"testing"
+
+	pb "github.com/lni/dragonboat/raftpb"
+)
+
+func TestChunkedRestoreStagesSeparatelyFromTheCommittedSnapshot(t *testing.T) {
+	im := newInMemory(0)
+	dir := t.TempDir()
+	if err := im.beginRestore(dir, 10, 2); err != nil {
+		t.Fatalf("beginRestore failed: %v", err)
+	}
+	if idx, ok := im.getSnapshotIndex(); ok {
+		t.Fatalf("unexpected committed snapshot index %d before finalizeRestore", idx)
+	}
+	data := []byte("snapshot payload")
+	chunk := SnapshotChunk{Offset: 0, Data: data, Checksum: crc32.ChecksumIEEE(data)}
+	if err := im.appendChunk(chunk); err != nil {
+		t.Fatalf("appendChunk failed: %v", err)
+	}
+	if err := im.finalizeRestore(); err != nil {
+		t.Fatalf("finalizeRestore failed: %v", err)
+	}
+	if idx, ok := im.getSnapshotIndex(); !ok || idx != 10 {
+		t.Fatalf("committed snapshot index got %d, %v, want 10, true", idx, ok)
+	}
+}
+
+func TestAppendChunkRejectsBadChecksum(t *testing.T) {
+	im := newInMemory(0)
+	dir := t.TempDir()
+	if err := im.beginRestore(dir, 10, 2); err != nil {
+		t.Fatalf("beginRestore failed: %v", err)
+	}
+	if err := im.appendChunk(SnapshotChunk{Offset: 0, Data: []byte("x"), Checksum: 0}); err == nil {
+		t.Fatalf("expected appendChunk to reject a corrupted chunk")
+	}
+}
+
+func TestCancelRestoreLeavesTheCommittedSnapshotUntouched(t *testing.T) {
+	im := newInMemory(0)
+	im.Restore(pb.Snapshot{Index: 5, Term: 1})
+	dir := t.TempDir()
+	if err := im.beginRestore(dir, 10, 2); err != nil {
+		t.Fatalf("beginRestore failed: %v", err)
+	}
+	im.cancelRestore()
+	if idx, ok := im.getSnapshotIndex(); !ok || idx != 5 {
+		t.Fatalf("committed snapshot index got %d, %v, want 5, true", idx, ok)
+	}
+	if im.pending != nil {
+		t.Fatalf("cancelRestore left a pending snapshot behind")
+	}
+}
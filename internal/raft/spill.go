@@ -0,0 +1,171 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	pb "github.com/lni/dragonboat/raftpb"
+)
+
+// entrySpillSegment describes a contiguous run of unstable log entries
+// that has been written to a single file on disk.
+type entrySpillSegment struct {
+	low   uint64 // inclusive
+	high  uint64 // exclusive
+	path  string
+	bytes uint64
+}
+
+// entrySpill is a lightweight on-disk ring buffer used by inMemory to
+// offload the oldest entries of its unsaved tail when the process heap
+// would otherwise grow without bound, e.g. when the stable log writer's
+// fsync path falls behind a sustained write burst. Segments are always
+// appended and faulted back sequentially, there is no random access
+// requirement as the raft loop only ever consumes the unstable log from
+// its front.
+type entrySpill struct {
+	dir      string
+	segments []entrySpillSegment
+	bytes    uint64
+	seq      uint64
+}
+
+func newEntrySpill(dir string) *entrySpill {
+	return &entrySpill{dir: dir}
+}
+
+// spill writes ents to a new segment file and records it, returning the
+// segment's index range.
+func (es *entrySpill) spill(ents []pb.Entry) (entrySpillSegment, error) {
+	if len(ents) == 0 {
+		return entrySpillSegment{}, nil
+	}
+	es.seq++
+	name := fmt.Sprintf("spill-%020d-%020d.tmp", ents[0].Index, es.seq)
+	path := filepath.Join(es.dir, name)
+	data, err := marshalEntrySlice(ents)
+	if err != nil {
+		return entrySpillSegment{}, err
+	}
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return entrySpillSegment{}, err
+	}
+	seg := entrySpillSegment{
+		low:   ents[0].Index,
+		high:  ents[len(ents)-1].Index + 1,
+		path:  path,
+		bytes: uint64(len(data)),
+	}
+	es.segments = append(es.segments, seg)
+	es.bytes += seg.bytes
+	return seg, nil
+}
+
+// fault reads back every spilled entry whose index falls within
+// [low, high) across however many segments it spans.
+func (es *entrySpill) fault(low uint64, high uint64) ([]pb.Entry, error) {
+	result := make([]pb.Entry, 0, high-low)
+	for _, seg := range es.segments {
+		if seg.high <= low || seg.low >= high {
+			continue
+		}
+		data, err := ioutil.ReadFile(seg.path)
+		if err != nil {
+			return nil, err
+		}
+		ents, err := unmarshalEntrySlice(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, ent := range ents {
+			if ent.Index >= low && ent.Index < high {
+				result = append(result, ent)
+			}
+		}
+	}
+	return result, nil
+}
+
+// drop removes every segment whose entries all have an index below upTo.
+// inMemory calls it from AppliedLogTo with the new marker index, once it
+// no longer serves those entries; an acknowledgement by stable storage
+// alone does not drop any segment.
+func (es *entrySpill) drop(upTo uint64) {
+	kept := es.segments[:0]
+	for _, seg := range es.segments {
+		if seg.high <= upTo {
+			if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+				plog.Warningf("failed to remove spill segment %s, %v", seg.path, err)
+			}
+			es.bytes -= seg.bytes
+			continue
+		}
+		kept = append(kept, seg)
+	}
+	es.segments = kept
+}
+
+// purge discards every staged segment, e.g. on snapshot restore or when
+// Merge rebuilds the resident log after a conflicting append.
+func (es *entrySpill) purge() {
+	for _, seg := range es.segments {
+		if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+			plog.Warningf("failed to remove spill segment %s, %v", seg.path, err)
+		}
+	}
+	es.segments = nil
+	es.bytes = 0
+}
+
+func marshalEntrySlice(ents []pb.Entry) ([]byte, error) {
+	var buf []byte
+	for _, ent := range ents {
+		data, err := ent.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		var szbuf [8]byte
+		binary.LittleEndian.PutUint64(szbuf[:], uint64(len(data)))
+		buf = append(buf, szbuf[:]...)
+		buf = append(buf, data...)
+	}
+	return buf, nil
+}
+
+func unmarshalEntrySlice(data []byte) ([]pb.Entry, error) {
+	var ents []pb.Entry
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, fmt.Errorf("corrupted spill segment")
+		}
+		sz := binary.LittleEndian.Uint64(data[:8])
+		data = data[8:]
+		if uint64(len(data)) < sz {
+			return nil, fmt.Errorf("corrupted spill segment")
+		}
+		var ent pb.Entry
+		if err := ent.Unmarshal(data[:sz]); err != nil {
+			return nil, err
+		}
+		ents = append(ents, ent)
+		data = data[sz:]
+	}
+	return ents, nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import pb "github.com/lni/dragonboat/raftpb"
+
+// UnstableLog abstracts the storage of log entries that have not yet
+// been confirmed as stable by the raft state machine. inMemory, the
+// implementation used by default, keeps the unsaved tail in a pageList
+// and optionally spills its oldest entries to disk under memory
+// pressure. Embedders that need something else, e.g. a copy-on-write
+// variant for snapshotting the log for read replicas, or an mmap-backed
+// variant for very large in-flight windows, can provide their own
+// implementation and select it through unstableLogFactory the same way
+// log DB plugins are selected.
+type UnstableLog interface {
+	GetEntries(low uint64, high uint64) []pb.Entry
+	GetTerm(index uint64) (uint64, bool)
+	GetLastIndex() (uint64, bool)
+	Merge(entries []pb.Entry)
+	Restore(ss pb.Snapshot)
+	EntriesToSave() []pb.Entry
+	CommitUpdate(cu pb.UpdateCommit)
+	AppliedLogTo(index uint64)
+}
+
+// unstableLogFactory creates the UnstableLog instance used by a newly
+// constructed raft instance.
+type unstableLogFactory func(lastIndex uint64) UnstableLog
+
+// defaultUnstableLogFactory is the unstableLogFactory in effect, it
+// defaults to the in-memory page list based implementation. Embedders wire
+// in an alternative implementation by replacing it before any raft
+// instances are created.
+var defaultUnstableLogFactory unstableLogFactory = newInMemoryUnstableLog
+
+func newInMemoryUnstableLog(lastIndex uint64) UnstableLog {
+	im := newInMemory(lastIndex)
+	return &im
+}
+
+// newUnstableLog creates the configured UnstableLog implementation for a
+// new raft instance. raft.raft must construct its unstable log through
+// this selector rather than calling newInMemory directly, that is what
+// lets a test or an embedder swap in an alternative implementation by
+// replacing defaultUnstableLogFactory beforehand.
+//
+// TODO(raft): raft.raft does not exist in this package slice of the tree
+// yet and so cannot be wired up from here. newUnstableLog itself has no
+// production caller until that lands; confirm the wiring is in place
+// before this is considered done, unstablelog_test.go alone is not
+// sufficient proof.
+func newUnstableLog(lastIndex uint64) UnstableLog {
+	return defaultUnstableLogFactory(lastIndex)
+}
+
+// inMemory must keep satisfying UnstableLog.
+var _ UnstableLog = (*inMemory)(nil)
@@ -0,0 +1,54 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"testing"
+
+	pb "github.com/lni/dragonboat/raftpb"
+)
+
+// mockUnstableLog is a minimal UnstableLog stand-in used to prove the
+// factory selector actually lets callers swap out the default in-memory
+// implementation, e.g. for a test that wants to assert on Merge calls
+// without exercising inMemory's spill/page-list machinery.
+type mockUnstableLog struct {
+	merged []pb.Entry
+}
+
+func (m *mockUnstableLog) GetEntries(low uint64, high uint64) []pb.Entry { return nil }
+func (m *mockUnstableLog) GetTerm(index uint64) (uint64, bool)           { return 0, false }
+func (m *mockUnstableLog) GetLastIndex() (uint64, bool)                  { return 0, false }
+func (m *mockUnstableLog) Merge(entries []pb.Entry)                      { m.merged = append(m.merged, entries...) }
+func (m *mockUnstableLog) Restore(ss pb.Snapshot)                        {}
+func (m *mockUnstableLog) EntriesToSave() []pb.Entry                     { return nil }
+func (m *mockUnstableLog) CommitUpdate(cu pb.UpdateCommit)               {}
+func (m *mockUnstableLog) AppliedLogTo(index uint64)                     {}
+
+func TestNewUnstableLogUsesTheConfiguredFactory(t *testing.T) {
+	mock := &mockUnstableLog{}
+	old := defaultUnstableLogFactory
+	defer func() { defaultUnstableLogFactory = old }()
+	defaultUnstableLogFactory = func(lastIndex uint64) UnstableLog { return mock }
+
+	ul := newUnstableLog(100)
+	if ul != UnstableLog(mock) {
+		t.Fatalf("newUnstableLog did not return the injected mock")
+	}
+	ul.Merge([]pb.Entry{{Index: 101, Term: 1}})
+	if len(mock.merged) != 1 || mock.merged[0].Index != 101 {
+		t.Fatalf("unexpected merged entries %+v", mock.merged)
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package settings contains soft settings that can be changed by end users
+// to configure internal details of dragonboat.
+package settings
+
+// SoftSettings is the soft settings that can be adjusted by end users.
+type SoftSettings struct {
+	// InMemEntrySpillByteThreshold is the size in bytes, summed across the
+	// unsaved tail of the unstable log (entries with index > savedTo),
+	// above which inMemory starts spilling the oldest such entries to disk
+	// rather than keeping them all resident on the heap.
+	InMemEntrySpillByteThreshold uint64
+	// InMemEntrySpillEntryThreshold is the entry count equivalent of
+	// InMemEntrySpillByteThreshold, whichever threshold is reached first
+	// triggers a spill.
+	InMemEntrySpillEntryThreshold uint64
+}
+
+// Soft is the soft settings instance used by dragonboat.
+var Soft = SoftSettings{
+	InMemEntrySpillByteThreshold:  64 * 1024 * 1024,
+	InMemEntrySpillEntryThreshold: 10000,
+}